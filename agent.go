@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// honeyAgent is an agent.Agent that plays along with whatever it is asked,
+// but never actually signs anything: it exists to capture keys and sign
+// requests forwarded by clients that enable agent forwarding (-A), not to
+// provide usable agent functionality.
+type honeyAgent struct {
+	logEntry *logrus.Entry
+}
+
+func (a honeyAgent) List() ([]*agent.Key, error) {
+	a.logEntry.Infoln("Agent forwarding: identities requested")
+	return nil, nil
+}
+
+func (a honeyAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	a.logEntry.WithFields(logrus.Fields{
+		"public_key_fingerprint": ssh.FingerprintSHA256(key),
+		"data_length":            len(data),
+	}).Infoln("Agent forwarding: sign request")
+	return nil, errors.New("signing not supported")
+}
+
+func (a honeyAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	a.logEntry.WithFields(logrus.Fields{
+		"public_key_fingerprint": ssh.FingerprintSHA256(key),
+		"data_length":            len(data),
+		"flags":                  flags,
+	}).Infoln("Agent forwarding: sign request")
+	return nil, errors.New("signing not supported")
+}
+
+func (a honeyAgent) Add(key agent.AddedKey) error {
+	logEntry := a.logEntry.WithField("comment", key.Comment)
+	keyBytes, err := marshalAddedPrivateKey(key.PrivateKey)
+	if err != nil {
+		logEntry.WithError(err).Warnln("Agent forwarding: failed to marshal added identity")
+	} else {
+		logEntry = logEntry.WithField("private_key", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})))
+	}
+	logEntry.Infoln("Agent forwarding: identity added")
+	return nil
+}
+
+// marshalAddedPrivateKey marshals the private key of an agent.AddedKey as
+// PKCS#8. ssh/agent unmarshals wire-format ed25519 keys into
+// *ed25519.PrivateKey rather than the ed25519.PrivateKey value
+// x509.MarshalPKCS8PrivateKey expects, so that case is unwrapped first.
+func marshalAddedPrivateKey(key interface{}) ([]byte, error) {
+	if ed25519Key, ok := key.(*ed25519.PrivateKey); ok {
+		key = *ed25519Key
+	}
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+func (a honeyAgent) Remove(key ssh.PublicKey) error {
+	a.logEntry.WithField("public_key_fingerprint", ssh.FingerprintSHA256(key)).Infoln("Agent forwarding: identity removed")
+	return nil
+}
+
+func (a honeyAgent) RemoveAll() error {
+	a.logEntry.Infoln("Agent forwarding: all identities removed")
+	return nil
+}
+
+func (a honeyAgent) Lock(passphrase []byte) error {
+	a.logEntry.Infoln("Agent forwarding: lock requested")
+	return nil
+}
+
+func (a honeyAgent) Unlock(passphrase []byte) error {
+	a.logEntry.Infoln("Agent forwarding: unlock requested")
+	return nil
+}
+
+func (a honeyAgent) Signers() ([]ssh.Signer, error) {
+	a.logEntry.Infoln("Agent forwarding: signers requested")
+	return nil, nil
+}
+
+// handleAgentChannel serves the ssh-agent protocol on an accepted
+// auth-agent@openssh.com channel, recording everything the client's
+// forwarded agent is asked to do.
+func handleAgentChannel(channel ssh.Channel, logEntry *logrus.Entry) {
+	defer channel.Close()
+	agent.ServeAgent(honeyAgent{logEntry: logEntry}, channel)
+}
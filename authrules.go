@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// authRule is a single entry of the AuthRules config section: an ordered
+// match/action policy evaluated by evaluateAuthRules for every auth
+// attempt. A zero-value matcher field means "don't care".
+type authRule struct {
+	UsernameRegex        string
+	SourceCIDR           string
+	PasswordRegex        string
+	PublicKeyFingerprint string
+	Method               string
+	Action               string
+	Tries                int
+	TarpitMs             int
+}
+
+// authRuleContext carries the per-attempt details an authRule can match
+// against; fields that don't apply to the current auth method are left
+// at their zero value.
+type authRuleContext struct {
+	method      string
+	conn        ssh.ConnMetadata
+	password    string
+	fingerprint string
+}
+
+// authRuleTries counts "reject_after_n_tries" attempts per remote host
+// (the source port is ignored), username and rule, across the lifetime
+// of the process.
+var authRuleTries sync.Map
+
+// evaluateAuthRules runs the configured AuthRules in order against ctx
+// and returns the accept/reject decision of the first rule that
+// matches, a description of that rule for logging, and whether any rule
+// matched at all. Rules whose Action is not recognised are skipped even
+// when they match. When no rule matches, ok is false and the caller
+// should fall back to its own Accepted flag.
+func evaluateAuthRules(rules []authRule, ctx authRuleContext) (accept bool, description string, ok bool) {
+	for _, rule := range rules {
+		if !authRuleMatches(rule, ctx) {
+			continue
+		}
+		switch rule.Action {
+		case "accept":
+			return true, describeAuthRule(rule), true
+		case "reject":
+			return false, describeAuthRule(rule), true
+		case "reject_after_n_tries":
+			host, _, err := net.SplitHostPort(ctx.conn.RemoteAddr().String())
+			if err != nil {
+				host = ctx.conn.RemoteAddr().String()
+			}
+			key := fmt.Sprintf("%v|%v|%v", host, ctx.conn.User(), describeAuthRule(rule))
+			value, _ := authRuleTries.LoadOrStore(key, new(int64))
+			tries := atomic.AddInt64(value.(*int64), 1)
+			if int(tries) > rule.Tries {
+				return false, describeAuthRule(rule), true
+			}
+			return true, describeAuthRule(rule), true
+		case "tarpit_ms":
+			time.Sleep(time.Duration(rule.TarpitMs) * time.Millisecond)
+			return false, describeAuthRule(rule), true
+		default:
+			continue
+		}
+	}
+	return false, "", false
+}
+
+func authRuleMatches(rule authRule, ctx authRuleContext) bool {
+	if rule.Method != "" && rule.Method != ctx.method {
+		return false
+	}
+	if rule.UsernameRegex != "" {
+		matched, err := regexp.MatchString(rule.UsernameRegex, ctx.conn.User())
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if rule.SourceCIDR != "" {
+		if !sourceMatchesCIDR(rule.SourceCIDR, ctx.conn.RemoteAddr()) {
+			return false
+		}
+	}
+	if rule.PasswordRegex != "" {
+		if ctx.method != "password" {
+			return false
+		}
+		matched, err := regexp.MatchString(rule.PasswordRegex, ctx.password)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if rule.PublicKeyFingerprint != "" {
+		if ctx.method != "publickey" || rule.PublicKeyFingerprint != ctx.fingerprint {
+			return false
+		}
+	}
+	return true
+}
+
+func sourceMatchesCIDR(cidr string, addr net.Addr) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return network.Contains(ip)
+}
+
+func describeAuthRule(rule authRule) string {
+	return fmt.Sprintf("%+v", rule)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+type fakeConnMetadata struct {
+	user       string
+	remoteAddr net.Addr
+}
+
+func (c fakeConnMetadata) User() string          { return c.user }
+func (c fakeConnMetadata) SessionID() []byte     { return nil }
+func (c fakeConnMetadata) ClientVersion() []byte { return nil }
+func (c fakeConnMetadata) ServerVersion() []byte { return nil }
+func (c fakeConnMetadata) RemoteAddr() net.Addr  { return c.remoteAddr }
+func (c fakeConnMetadata) LocalAddr() net.Addr   { return nil }
+
+func mustResolveTCPAddr(t *testing.T, address string) *net.TCPAddr {
+	t.Helper()
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+func TestEvaluateAuthRulesPrecedence(t *testing.T) {
+	rules := []authRule{
+		{UsernameRegex: "^admin$", Action: "reject"},
+		{UsernameRegex: "^admin$", Action: "accept"},
+	}
+	ctx := authRuleContext{
+		method: "password",
+		conn:   fakeConnMetadata{user: "admin", remoteAddr: mustResolveTCPAddr(t, "203.0.113.1:1234")},
+	}
+	accept, _, ok := evaluateAuthRules(rules, ctx)
+	if !ok || accept {
+		t.Fatalf("expected the first matching rule (reject) to win, got accept=%v ok=%v", accept, ok)
+	}
+}
+
+func TestEvaluateAuthRulesNoMatch(t *testing.T) {
+	rules := []authRule{
+		{UsernameRegex: "^root$", Action: "accept"},
+	}
+	ctx := authRuleContext{
+		method: "password",
+		conn:   fakeConnMetadata{user: "admin", remoteAddr: mustResolveTCPAddr(t, "203.0.113.1:1234")},
+	}
+	_, _, ok := evaluateAuthRules(rules, ctx)
+	if ok {
+		t.Fatal("expected no rule to match")
+	}
+}
+
+func TestEvaluateAuthRulesSourceCIDR(t *testing.T) {
+	rules := []authRule{
+		{SourceCIDR: "10.0.0.0/8", Action: "accept"},
+	}
+	matching := authRuleContext{
+		method: "password",
+		conn:   fakeConnMetadata{user: "anyone", remoteAddr: mustResolveTCPAddr(t, "10.1.2.3:1234")},
+	}
+	if accept, _, ok := evaluateAuthRules(rules, matching); !ok || !accept {
+		t.Fatalf("expected address inside CIDR to match and accept, got accept=%v ok=%v", accept, ok)
+	}
+
+	nonMatching := authRuleContext{
+		method: "password",
+		conn:   fakeConnMetadata{user: "anyone", remoteAddr: mustResolveTCPAddr(t, "203.0.113.1:1234")},
+	}
+	if _, _, ok := evaluateAuthRules(rules, nonMatching); ok {
+		t.Fatal("expected address outside CIDR not to match")
+	}
+}
+
+func TestEvaluateAuthRulesMethodFilter(t *testing.T) {
+	rules := []authRule{
+		{Method: "publickey", Action: "reject"},
+	}
+	ctx := authRuleContext{
+		method: "password",
+		conn:   fakeConnMetadata{user: "anyone", remoteAddr: mustResolveTCPAddr(t, "203.0.113.1:1234")},
+	}
+	if _, _, ok := evaluateAuthRules(rules, ctx); ok {
+		t.Fatal("expected rule scoped to publickey not to match a password attempt")
+	}
+}
+
+func TestEvaluateAuthRulesRejectAfterNTries(t *testing.T) {
+	rules := []authRule{
+		{UsernameRegex: "^bruteforce$", Action: "reject_after_n_tries", Tries: 2},
+	}
+	// Each attempt reconnects from a new ephemeral port, as a real brute-forcer
+	// would; the try counter must key on the host rather than host:port, or it
+	// never accumulates.
+	addresses := []string{"203.0.113.9:1234", "203.0.113.9:5678", "203.0.113.9:9012"}
+	for i, address := range addresses[:2] {
+		ctx := authRuleContext{
+			method: "password",
+			conn:   fakeConnMetadata{user: "bruteforce", remoteAddr: mustResolveTCPAddr(t, address)},
+		}
+		if accept, _, ok := evaluateAuthRules(rules, ctx); !ok || !accept {
+			t.Fatalf("attempt %d: expected accept within the try budget, got accept=%v ok=%v", i+1, accept, ok)
+		}
+	}
+	ctx := authRuleContext{
+		method: "password",
+		conn:   fakeConnMetadata{user: "bruteforce", remoteAddr: mustResolveTCPAddr(t, addresses[2])},
+	}
+	if accept, _, ok := evaluateAuthRules(rules, ctx); !ok || accept {
+		t.Fatalf("expected the attempt past the try budget, from a new port on the same host, to be rejected, got accept=%v ok=%v", accept, ok)
+	}
+}
@@ -1,13 +1,6 @@
 package main
 
 import (
-	"crypto/ecdsa"
-	"crypto/ed25519"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"io/ioutil"
 	"log"
@@ -22,16 +15,28 @@ import (
 )
 
 type config struct {
-	ListenAddress           string
-	RekeyThreshold          uint64
-	KeyExchanges            []string
-	Ciphers                 []string
-	MACs                    []string
-	HostKeys                []string
-	NoClientAuth            bool
-	MaxAuthTries            int
-	PasswordAuth            struct{ Enabled, Accepted bool }
-	PublicKeyAuth           struct{ Enabled, Accepted bool }
+	ListenAddress    string
+	RekeyThreshold   uint64
+	KeyExchanges     []string
+	Ciphers          []string
+	MACs             []string
+	HostKeys         []string
+	HostCertificates []struct {
+		Key         string
+		Certificate string
+	}
+	HostCertificateAuthority string
+	NoClientAuth             bool
+	MaxAuthTries             int
+	PasswordAuth             struct {
+		Enabled, Accepted bool
+		Credentials       []string
+		CredentialsFile   string
+	}
+	PublicKeyAuth struct {
+		Enabled, Accepted  bool
+		AuthorizedKeysFile string
+	}
 	KeyboardInteractiveAuth struct {
 		Enabled, Accepted bool
 		Instruction       string
@@ -40,6 +45,15 @@ type config struct {
 			Echo bool
 		}
 	}
+	AgentForwarding   struct{ Enabled, Accepted bool }
+	HostKeyGeneration struct {
+		RSABits    int
+		ECDSACurve string
+		Format     string
+		Passphrase string
+		EnableDSA  bool
+	}
+	AuthRules     []authRule
 	ServerVersion string
 	Banner        string
 }
@@ -64,24 +78,74 @@ func (cfg config) createSSHServerConfig() *ssh.ServerConfig {
 		BannerCallback: func(conn ssh.ConnMetadata) string { return strings.ReplaceAll(cfg.Banner, "\n", "\r\n") },
 	}
 	if cfg.PasswordAuth.Enabled {
+		credentials, err := loadPasswordCredentials(cfg)
+		if err != nil {
+			log.Fatalln("Failed to load password credentials:", err)
+		}
 		sshServerConfig.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			accepted := cfg.PasswordAuth.Accepted
+			match := "no match"
+			if len(credentials) > 0 {
+				if credential, ok := matchPasswordCredential(credentials, conn.User(), password); ok {
+					accepted = true
+					match = credential
+				} else {
+					accepted = false
+				}
+			}
+			if decision, ruleDescription, ok := evaluateAuthRules(cfg.AuthRules, authRuleContext{
+				method:   "password",
+				conn:     conn,
+				password: string(password),
+			}); ok {
+				accepted = decision
+				getLogEntry(conn).WithField("rule", ruleDescription).Infoln("Auth rule matched")
+			}
 			getLogEntry(conn).WithFields(logrus.Fields{
 				"password": string(password),
-				"success":  cfg.PasswordAuth.Accepted,
+				"success":  accepted,
+				"match":    match,
 			}).Infoln("Password authentication attempted")
-			if !cfg.PasswordAuth.Accepted {
+			if !accepted {
 				return nil, errors.New("")
 			}
 			return nil, nil
 		}
 	}
 	if cfg.PublicKeyAuth.Enabled {
+		var authorizedKeys []ssh.PublicKey
+		if cfg.PublicKeyAuth.AuthorizedKeysFile != "" {
+			var err error
+			authorizedKeys, err = loadAuthorizedKeys(cfg.PublicKeyAuth.AuthorizedKeysFile)
+			if err != nil {
+				log.Fatalln("Failed to load authorized keys", cfg.PublicKeyAuth.AuthorizedKeysFile, ":", err)
+			}
+		}
 		sshServerConfig.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			accepted := cfg.PublicKeyAuth.Accepted
+			match := "no match"
+			if len(authorizedKeys) > 0 {
+				if matchAuthorizedKey(authorizedKeys, key) {
+					accepted = true
+					match = ssh.FingerprintSHA256(key)
+				} else {
+					accepted = false
+				}
+			}
+			if decision, ruleDescription, ok := evaluateAuthRules(cfg.AuthRules, authRuleContext{
+				method:      "publickey",
+				conn:        conn,
+				fingerprint: ssh.FingerprintSHA256(key),
+			}); ok {
+				accepted = decision
+				getLogEntry(conn).WithField("rule", ruleDescription).Infoln("Auth rule matched")
+			}
 			getLogEntry(conn).WithFields(logrus.Fields{
 				"public_key_fingerprint": ssh.FingerprintSHA256(key),
-				"success":                cfg.PublicKeyAuth.Accepted,
+				"success":                accepted,
+				"match":                  match,
 			}).Infoln("Public key authentication attempted")
-			if !cfg.PublicKeyAuth.Accepted {
+			if !accepted {
 				return nil, errors.New("")
 			}
 			return nil, nil
@@ -100,11 +164,19 @@ func (cfg config) createSSHServerConfig() *ssh.ServerConfig {
 				log.Println("Failed to process keyboard interactive authentication:", err)
 				return nil, errors.New("")
 			}
+			accepted := cfg.KeyboardInteractiveAuth.Accepted
+			if decision, ruleDescription, ok := evaluateAuthRules(cfg.AuthRules, authRuleContext{
+				method: "keyboard-interactive",
+				conn:   conn,
+			}); ok {
+				accepted = decision
+				getLogEntry(conn).WithField("rule", ruleDescription).Infoln("Auth rule matched")
+			}
 			getLogEntry(conn).WithFields(logrus.Fields{
 				"answers": strings.Join(answers, ", "),
-				"success": cfg.KeyboardInteractiveAuth.Accepted,
+				"success": accepted,
 			}).Infoln("Keyboard interactive authentication attempted")
-			if !cfg.KeyboardInteractiveAuth.Accepted {
+			if !accepted {
 				return nil, errors.New("")
 			}
 			return nil, nil
@@ -121,6 +193,13 @@ func (cfg config) createSSHServerConfig() *ssh.ServerConfig {
 		}
 		sshServerConfig.AddHostKey(signer)
 	}
+	for _, hostCertificate := range cfg.HostCertificates {
+		signer, err := loadHostCertificate(hostCertificate.Key, hostCertificate.Certificate)
+		if err != nil {
+			log.Fatalln("Failed to load host certificate", hostCertificate.Certificate, ":", err)
+		}
+		sshServerConfig.AddHostKey(signer)
+	}
 	return sshServerConfig
 }
 
@@ -130,44 +209,9 @@ const (
 	rsa_key hostKeyType = iota
 	ecdsa_key
 	ed25519_key
+	dsa_key
 )
 
-func generateKey(fileName string, keyType hostKeyType) error {
-	if _, err := os.Stat(fileName); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-		log.Println("Host key", fileName, "not found, generating it")
-		if _, err := os.Stat(path.Dir(fileName)); os.IsNotExist(err) {
-			if err := os.MkdirAll(path.Dir(fileName), 0755); err != nil {
-				return err
-			}
-		}
-		var key interface{}
-		switch keyType {
-		case rsa_key:
-			key, err = rsa.GenerateKey(rand.Reader, 3072)
-		case ecdsa_key:
-			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-		case ed25519_key:
-			_, key, err = ed25519.GenerateKey(rand.Reader)
-		default:
-			err = errors.New("unsupported key type")
-		}
-		if err != nil {
-			return err
-		}
-		keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
-		if err != nil {
-			return err
-		}
-		if err := ioutil.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func getConfig(fileName string) (*config, error) {
 	result := &config{
 		ListenAddress: "127.0.0.1:2022",
@@ -202,19 +246,50 @@ func getConfig(fileName string) (*config, error) {
 		dataDir := path.Join(xdg.DataHome, "sshesame")
 		log.Println("No host keys configured, using keys at", dataDir)
 
-		for _, key := range []struct {
+		keys := []struct {
 			keyType  hostKeyType
 			filename string
 		}{
 			{keyType: rsa_key, filename: "host_rsa_key"},
 			{keyType: ecdsa_key, filename: "host_ecdsa_key"},
 			{keyType: ed25519_key, filename: "host_ed25519_key"},
-		} {
+		}
+		if result.HostKeyGeneration.EnableDSA {
+			keys = append(keys, struct {
+				keyType  hostKeyType
+				filename string
+			}{keyType: dsa_key, filename: "host_dsa_key"})
+		}
+		// generateKey defaults RSABits/ECDSACurve to the historic 3072/P256
+		// when left at their zero value, so configs that don't set
+		// HostKeyGeneration keep today's behavior unchanged.
+		keyGenOptions := KeyGenOptions{
+			RSABits:    result.HostKeyGeneration.RSABits,
+			ECDSACurve: result.HostKeyGeneration.ECDSACurve,
+			Format:     result.HostKeyGeneration.Format,
+			Passphrase: result.HostKeyGeneration.Passphrase,
+		}
+		if result.HostCertificateAuthority != "" {
+			if err := generateKey(result.HostCertificateAuthority, ed25519_key, KeyGenOptions{}); err != nil {
+				return nil, err
+			}
+		}
+		for _, key := range keys {
 			keyFileName := path.Join(dataDir, key.filename)
-			if err := generateKey(keyFileName, key.keyType); err != nil {
+			if err := generateKey(keyFileName, key.keyType, keyGenOptions); err != nil {
 				return nil, err
 			}
-			result.HostKeys = []string{keyFileName}
+			result.HostKeys = append(result.HostKeys, keyFileName)
+			if result.HostCertificateAuthority != "" {
+				certificateFileName, err := generateHostCertificate(keyFileName, result.HostCertificateAuthority)
+				if err != nil {
+					return nil, err
+				}
+				result.HostCertificates = append(result.HostCertificates, struct {
+					Key         string
+					Certificate string
+				}{Key: keyFileName, Certificate: certificateFileName})
+			}
 		}
 	}
 
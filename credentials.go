@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// loadPasswordCredentials returns the configured "user:password" pairs,
+// combining the inline list with the contents of CredentialsFile, if set.
+func loadPasswordCredentials(cfg config) ([]string, error) {
+	credentials := append([]string{}, cfg.PasswordAuth.Credentials...)
+	if cfg.PasswordAuth.CredentialsFile == "" {
+		return credentials, nil
+	}
+	fileBytes, err := ioutil.ReadFile(cfg.PasswordAuth.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(fileBytes), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		credentials = append(credentials, line)
+	}
+	return credentials, nil
+}
+
+// matchPasswordCredential reports which configured "user:password" entry, if
+// any, matches the given username and password.
+func matchPasswordCredential(credentials []string, user string, password []byte) (string, bool) {
+	entry := fmt.Sprintf("%v:%v", user, string(password))
+	for _, credential := range credentials {
+		if credential == entry {
+			return credential, true
+		}
+	}
+	return "", false
+}
+
+// loadAuthorizedKeys parses a standard OpenSSH authorized_keys file.
+func loadAuthorizedKeys(fileName string) ([]ssh.PublicKey, error) {
+	fileBytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	rest := fileBytes
+	for len(strings.TrimSpace(string(rest))) > 0 {
+		key, _, _, remaining, err := ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			if len(keys) > 0 {
+				// Only comments or unparsable lines follow the last key.
+				break
+			}
+			return nil, err
+		}
+		keys = append(keys, key)
+		rest = remaining
+	}
+	return keys, nil
+}
+
+// matchAuthorizedKey reports whether key is present in authorizedKeys.
+func matchAuthorizedKey(authorizedKeys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, authorizedKey := range authorizedKeys {
+		if bytes.Equal(authorizedKey.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
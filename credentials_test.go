@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLoadPasswordCredentials(t *testing.T) {
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials.txt")
+	if err := os.WriteFile(credentialsFile, []byte("# comment\nroot:toor\n\nadmin:hunter2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var cfg config
+	cfg.PasswordAuth.Credentials = []string{"inline:pass"}
+	cfg.PasswordAuth.CredentialsFile = credentialsFile
+
+	credentials, err := loadPasswordCredentials(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"inline:pass", "root:toor", "admin:hunter2"}
+	if len(credentials) != len(want) {
+		t.Fatalf("got %v, want %v", credentials, want)
+	}
+	for i, credential := range want {
+		if credentials[i] != credential {
+			t.Fatalf("got %v, want %v", credentials, want)
+		}
+	}
+}
+
+func TestMatchPasswordCredential(t *testing.T) {
+	credentials := []string{"root:toor", "admin:hunter2"}
+	tests := []struct {
+		name      string
+		user      string
+		password  string
+		wantMatch string
+		wantOK    bool
+	}{
+		{"exact match", "root", "toor", "root:toor", true},
+		{"wrong password", "root", "wrong", "", false},
+		{"unknown user", "guest", "toor", "", false},
+		{"second entry", "admin", "hunter2", "admin:hunter2", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, ok := matchPasswordCredential(credentials, test.user, []byte(test.password))
+			if ok != test.wantOK || match != test.wantMatch {
+				t.Errorf("matchPasswordCredential(%q, %q) = (%q, %v), want (%q, %v)",
+					test.user, test.password, match, ok, test.wantMatch, test.wantOK)
+			}
+		})
+	}
+}
+
+func generateTestPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestLoadAuthorizedKeys(t *testing.T) {
+	keyA := generateTestPublicKey(t)
+	keyB := generateTestPublicKey(t)
+	dir := t.TempDir()
+	authorizedKeysFile := filepath.Join(dir, "authorized_keys")
+	contents := string(ssh.MarshalAuthorizedKey(keyA)) + "# comment\n" + string(ssh.MarshalAuthorizedKey(keyB))
+	if err := os.WriteFile(authorizedKeysFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := loadAuthorizedKeys(authorizedKeysFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+}
+
+func TestMatchAuthorizedKey(t *testing.T) {
+	keyA := generateTestPublicKey(t)
+	keyB := generateTestPublicKey(t)
+	authorizedKeys := []ssh.PublicKey{keyA}
+
+	if !matchAuthorizedKey(authorizedKeys, keyA) {
+		t.Error("expected keyA to match")
+	}
+	if matchAuthorizedKey(authorizedKeys, keyB) {
+		t.Error("expected keyB not to match")
+	}
+}
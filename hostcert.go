@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// loadHostCertificate reads a host key and a matching CA-signed
+// *-cert.pub certificate and returns a signer that presents the
+// certificate during the handshake, so the honeypot looks like a
+// fleet member rather than a lone self-signed host.
+func loadHostCertificate(keyFileName, certificateFileName string) (ssh.Signer, error) {
+	keyBytes, err := ioutil.ReadFile(keyFileName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	certificateBytes, err := ioutil.ReadFile(certificateFileName)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(certificateBytes)
+	if err != nil {
+		return nil, err
+	}
+	certificate, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not a certificate")
+	}
+	if certificate.CertType != ssh.HostCert {
+		return nil, errors.New("not a host certificate")
+	}
+	return ssh.NewCertSigner(certificate, key)
+}
+
+// generateHostCertificate mints a short-lived host certificate for
+// hostKey, signed by the CA key at caKeyFileName, and writes it next to
+// hostKey as hostKey + "-cert.pub" so sshesame can run out-of-the-box
+// against a self-generated CA for testing.
+func generateHostCertificate(hostKeyFileName, caKeyFileName string) (string, error) {
+	certificateFileName := hostKeyFileName + "-cert.pub"
+	if _, err := ioutil.ReadFile(certificateFileName); err == nil {
+		return certificateFileName, nil
+	}
+	hostKeyBytes, err := ioutil.ReadFile(hostKeyFileName)
+	if err != nil {
+		return "", err
+	}
+	hostSigner, err := ssh.ParsePrivateKey(hostKeyBytes)
+	if err != nil {
+		return "", err
+	}
+	caKeyBytes, err := ioutil.ReadFile(caKeyFileName)
+	if err != nil {
+		return "", err
+	}
+	caSigner, err := ssh.ParsePrivateKey(caKeyBytes)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	certificate := &ssh.Certificate{
+		Key:             hostSigner.PublicKey(),
+		Serial:          1,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{},
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(365 * 24 * time.Hour).Unix()),
+	}
+	if err := certificate.SignCert(rand.Reader, caSigner); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(certificateFileName, ssh.MarshalAuthorizedKey(certificate), 0644); err != nil {
+		return "", err
+	}
+	return certificateFileName, nil
+}
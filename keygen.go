@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyGenOptions controls the parameters used by generateKey, driven by the
+// HostKeyGeneration config section.
+type KeyGenOptions struct {
+	RSABits    int
+	ECDSACurve string
+	Format     string // "pkcs8" (default) or "openssh"
+	Passphrase string
+}
+
+func ecdsaCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "", "P256":
+		return elliptic.P256(), nil
+	case "P384":
+		return elliptic.P384(), nil
+	case "P521":
+		return elliptic.P521(), nil
+	default:
+		return nil, errors.New("unsupported ECDSA curve " + name)
+	}
+}
+
+func generateKey(fileName string, keyType hostKeyType, opts KeyGenOptions) error {
+	if _, err := os.Stat(fileName); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		log.Println("Host key", fileName, "not found, generating it")
+		if _, err := os.Stat(path.Dir(fileName)); os.IsNotExist(err) {
+			if err := os.MkdirAll(path.Dir(fileName), 0755); err != nil {
+				return err
+			}
+		}
+		var key interface{}
+		switch keyType {
+		case rsa_key:
+			rsaBits := opts.RSABits
+			if rsaBits == 0 {
+				rsaBits = 3072
+			}
+			key, err = rsa.GenerateKey(rand.Reader, rsaBits)
+		case ecdsa_key:
+			curve, curveErr := ecdsaCurve(opts.ECDSACurve)
+			if curveErr != nil {
+				return curveErr
+			}
+			key, err = ecdsa.GenerateKey(curve, rand.Reader)
+		case ed25519_key:
+			_, key, err = ed25519.GenerateKey(rand.Reader)
+		case dsa_key:
+			dsaKey := new(dsa.PrivateKey)
+			if err = dsa.GenerateParameters(&dsaKey.Parameters, rand.Reader, dsa.L1024N160); err == nil {
+				if err = dsa.GenerateKey(dsaKey, rand.Reader); err == nil {
+					key = dsaKey
+				}
+			}
+		default:
+			err = errors.New("unsupported key type")
+		}
+		if err != nil {
+			return err
+		}
+		keyBytes, err := marshalPrivateKey(key, opts)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fileName, keyBytes, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalPrivateKey encodes key as PEM, either in unencrypted PKCS#8 (the
+// historic sshesame default) or in OpenSSH private key format, which is
+// encrypted with opts.Passphrase when it is set; opts.Passphrase is not
+// used for PKCS#8 or DSA output. DSA keys, which PKCS#8 and the OpenSSH signer
+// helpers don't support, always use the legacy "DSA PRIVATE KEY" format.
+func marshalPrivateKey(key interface{}, opts KeyGenOptions) ([]byte, error) {
+	if dsaKey, ok := key.(*dsa.PrivateKey); ok {
+		return marshalDSAPrivateKey(dsaKey)
+	}
+	if opts.Format == "openssh" {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("key type does not support OpenSSH private key format")
+		}
+		var block *pem.Block
+		var err error
+		if opts.Passphrase != "" {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(signer, "", []byte(opts.Passphrase))
+		} else {
+			block, err = ssh.MarshalPrivateKey(signer, "")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(block), nil
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), nil
+}
+
+// dsaOpenSSLPrivateKey mirrors the classic OpenSSL "DSA PRIVATE KEY" ASN.1
+// structure, which is what OpenSSH itself still emits for ssh-dss keys.
+type dsaOpenSSLPrivateKey struct {
+	Version int
+	P       *big.Int
+	Q       *big.Int
+	G       *big.Int
+	Y       *big.Int
+	X       *big.Int
+}
+
+func marshalDSAPrivateKey(key *dsa.PrivateKey) ([]byte, error) {
+	keyBytes, err := asn1.Marshal(dsaOpenSSLPrivateKey{
+		Version: 0,
+		P:       key.P,
+		Q:       key.Q,
+		G:       key.G,
+		Y:       key.Y,
+		X:       key.X,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "DSA PRIVATE KEY", Bytes: keyBytes}), nil
+}
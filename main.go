@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"log"
+)
+
+func main() {
+	configFile := flag.String("config", "", "Path to a configuration file")
+	flag.Parse()
+
+	cfg, err := getConfig(*configFile)
+	if err != nil {
+		log.Fatalln("Failed to load configuration:", err)
+	}
+
+	if err := Run(*cfg); err != nil {
+		log.Fatalln(err)
+	}
+}
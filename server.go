@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Run listens on cfg.ListenAddress and serves the SSH honeypot,
+// handling each accepted connection on its own goroutine.
+func Run(cfg config) error {
+	sshServerConfig := cfg.createSSHServerConfig()
+	listener, err := net.Listen("tcp", cfg.ListenAddress)
+	if err != nil {
+		return err
+	}
+	logrus.Infoln("Listening on", listener.Addr())
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go handleConnection(netConn, cfg, sshServerConfig)
+	}
+}
+
+// handleConnection performs the SSH handshake on an accepted
+// connection and dispatches every resulting channel through
+// handleNewChannel, which is where e.g. auth-agent@openssh.com agent
+// channels are served.
+func handleConnection(netConn net.Conn, cfg config, sshServerConfig *ssh.ServerConfig) {
+	defer netConn.Close()
+	sshConn, channels, requests, err := ssh.NewServerConn(netConn, sshServerConfig)
+	if err != nil {
+		logrus.WithField("remote_addr", netConn.RemoteAddr()).WithError(err).Infoln("Failed to establish SSH connection")
+		return
+	}
+	defer sshConn.Close()
+	logEntry := getLogEntry(sshConn)
+	logEntry.Infoln("Connection established")
+	defer logEntry.Infoln("Connection closed")
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		go handleNewChannel(newChannel, cfg, logEntry)
+	}
+}
+
+// getLogEntry returns the logrus.Entry used to tag every log line
+// produced for a given SSH connection with its remote address and
+// username.
+func getLogEntry(conn ssh.ConnMetadata) *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{
+		"remote_addr": conn.RemoteAddr().String(),
+		"user":        conn.User(),
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// handleNewChannel dispatches an incoming channel to the appropriate
+// handler based on its type. Besides ordinary "session" channels, it
+// accepts "auth-agent@openssh.com" channels: the direct channel an
+// OpenSSH client opens back to the server after a session requests
+// agent forwarding, carrying the ssh-agent protocol itself.
+func handleNewChannel(newChannel ssh.NewChannel, cfg config, logEntry *logrus.Entry) {
+	switch newChannel.ChannelType() {
+	case "session":
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			logEntry.WithError(err).Warnln("Failed to accept channel")
+			return
+		}
+		go handleSessionRequests(channel, requests, cfg, logEntry)
+	case "auth-agent@openssh.com":
+		if !cfg.AgentForwarding.Enabled || !cfg.AgentForwarding.Accepted {
+			newChannel.Reject(ssh.Prohibited, "agent forwarding not accepted")
+			return
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			logEntry.WithError(err).Warnln("Failed to accept agent channel")
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		go handleAgentChannel(channel, logEntry)
+	default:
+		newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+	}
+}
+
+// handleSessionRequests services channel requests on a "session"
+// channel. auth-agent-req@openssh.com is the one relevant to agent
+// forwarding: an OpenSSH client sends it right after opening the
+// session when it was started with -A, and once accepted, opens the
+// auth-agent@openssh.com channel handled by handleNewChannel above.
+// The usual session requests (pty-req, shell, exec, ...) are accepted
+// as before so that adding agent forwarding doesn't break ordinary
+// sessions; they're only logged here, not interpreted.
+func handleSessionRequests(channel ssh.Channel, requests <-chan *ssh.Request, cfg config, logEntry *logrus.Entry) {
+	defer channel.Close()
+	for request := range requests {
+		switch request.Type {
+		case "auth-agent-req@openssh.com":
+			accepted := cfg.AgentForwarding.Enabled && cfg.AgentForwarding.Accepted
+			logEntry.WithField("success", accepted).Infoln("Agent forwarding requested")
+			replyToRequest(request, accepted, logEntry)
+		case "pty-req", "shell", "exec", "subsystem", "env", "x11-req":
+			logEntry.WithField("request_type", request.Type).Infoln("Session request received")
+			replyToRequest(request, true, logEntry)
+		case "window-change", "signal":
+			logEntry.WithField("request_type", request.Type).Infoln("Session request received")
+		default:
+			logEntry.WithField("request_type", request.Type).Infoln("Unknown session request received")
+			replyToRequest(request, false, logEntry)
+		}
+	}
+}
+
+func replyToRequest(request *ssh.Request, accepted bool, logEntry *logrus.Entry) {
+	if !request.WantReply {
+		return
+	}
+	if err := request.Reply(accepted, nil); err != nil {
+		logEntry.WithError(err).Warnln("Failed to reply to request")
+	}
+}